@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// newPushCommand builds the "push" subcommand, which copies a local file
+// out to every peer matching a tag instead of running a remote command.
+func newPushCommand() *ffcli.Command {
+	fs := flag.NewFlagSet("tailscale-multi-ssh push", flag.ExitOnError)
+
+	sshUser := fs.String("sshuser", "root", "SSH user (scp backend only)")
+	sshUserByTag := fs.String("sshuser-by-tag", "", "Resolve the SSH user per-peer from its tags, e.g. \"tag:prod=ubuntu,tag:dev=root\" (first match wins; falls back to -sshuser; scp backend only)")
+	backend := fs.String("push-backend", "scp", "File transfer backend: \"scp\" (copy over the existing SSH path) or \"peerapi\" (Tailscale Taildrop/PeerAPI file-put; ignores the destination path argument)")
+	insecureHostKeys := fs.Bool("insecure-host-keys", false, "With -push-backend=scp, connect to peers that don't advertise Tailscale SSH host keys without verifying the host key at all")
+	output := fs.String("output", "text", "Output format: \"text\", \"table\", \"json\", or \"ndjson\"")
+	maxParallel := fs.Int("max-parallel", 0, "Maximum number of hosts to push to concurrently (0 means min(number of selected hosts, 16))")
+
+	return &ffcli.Command{
+		Name:       "push",
+		ShortUsage: "tailscale-multi-ssh push [flags] <local-path> <tag> -- <remote-path>",
+		ShortHelp:  "Copy a local file to every peer matching <tag>",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			return runPush(ctx, args, *sshUser, *sshUserByTag, *backend, *insecureHostKeys, *output, *maxParallel)
+		},
+	}
+}
+
+// runPush resolves <local-path> <tag> -- <remote-path> from args, copies
+// local-path to every eligible peer matching tag, and reports the
+// results through the same Reporter machinery as the root command.
+func runPush(ctx context.Context, args []string, sshUser, sshUserByTag, backend string, insecureHostKeys bool, output string, maxParallel int) error {
+	localPath, tag, remotePath, err := splitPushArgs(args)
+	if err != nil {
+		return err
+	}
+
+	userRules, err := parseSSHUserByTag(sshUserByTag)
+	if err != nil {
+		return fmt.Errorf("parsing -sshuser-by-tag: %w", err)
+	}
+
+	reporter, err := newReporter(output, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("configuring -output: %w", err)
+	}
+
+	devices, err := getDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("getting devices: %w", err)
+	}
+
+	pusher, err := newPusher(backend, insecureHostKeys)
+	if err != nil {
+		return fmt.Errorf("configuring -push-backend: %w", err)
+	}
+
+	eligible := eligiblePeers(devices, tag)
+
+	limit := boundedParallelism(maxParallel, len(eligible))
+	results := runConcurrent(eligible, limit, func(device Peer) Result {
+		return pushOne(ctx, pusher, device, sshUserFor(device, sshUser, userRules), localPath, remotePath)
+	})
+
+	failed := false
+	for res := range results {
+		reporter.Report(res)
+		if res.Failed() {
+			failed = true
+		}
+	}
+
+	if err := reporter.Finish(); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if failed {
+		return errHostsFailed
+	}
+	return nil
+}
+
+// pushOne copies localPath to remotePath on device via pusher, turning
+// the outcome into a Result the same way runSSHCommand does for exec.
+func pushOne(ctx context.Context, pusher Pusher, device Peer, sshUser, localPath, remotePath string) Result {
+	res := Result{Hostname: device.Hostname, Tags: device.Tags}
+	if len(device.Addresses) > 0 {
+		res.IP = device.Addresses[0]
+	}
+
+	start := time.Now()
+	err := pusher.Push(ctx, device, sshUser, localPath, remotePath)
+	res.Duration = time.Since(start)
+	res.ExitCode = exitCodeFromError(err)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// splitPushArgs parses the positional args for push: <local-path> <tag>
+// -- <remote-path>. The literal "--" is required so a tag that happens
+// to look like a flag (e.g. "tag:web") is never mistaken for one.
+func splitPushArgs(args []string) (localPath, tag, remotePath string, err error) {
+	sep := -1
+	for i, a := range args {
+		if a == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep == -1 {
+		return "", "", "", fmt.Errorf("missing \"--\" separator before the remote destination path; want <local-path> <tag> -- <remote-path>")
+	}
+
+	before, after := args[:sep], args[sep+1:]
+	if len(before) != 2 {
+		return "", "", "", fmt.Errorf("want exactly <local-path> <tag> before \"--\", got %d argument(s)", len(before))
+	}
+	if len(after) != 1 {
+		return "", "", "", fmt.Errorf("want exactly one <remote-path> after \"--\", got %d argument(s)", len(after))
+	}
+	return before[0], before[1], after[0], nil
+}
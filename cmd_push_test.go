@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestSplitPushArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantLocal  string
+		wantTag    string
+		wantRemote string
+		wantErr    bool
+	}{
+		{
+			name:       "well-formed",
+			args:       []string{"./deploy.tar", "tag:web", "--", "/tmp/"},
+			wantLocal:  "./deploy.tar",
+			wantTag:    "tag:web",
+			wantRemote: "/tmp/",
+		},
+		{name: "missing separator", args: []string{"./deploy.tar", "tag:web", "/tmp/"}, wantErr: true},
+		{name: "too few args before separator", args: []string{"./deploy.tar", "--", "/tmp/"}, wantErr: true},
+		{name: "too many args before separator", args: []string{"./deploy.tar", "tag:web", "extra", "--", "/tmp/"}, wantErr: true},
+		{name: "too many args after separator", args: []string{"./deploy.tar", "tag:web", "--", "/tmp/", "extra"}, wantErr: true},
+		{name: "nothing after separator", args: []string{"./deploy.tar", "tag:web", "--"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, tag, remote, err := splitPushArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("splitPushArgs(%v) = (%q, %q, %q), nil; want error", tt.args, local, tag, remote)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitPushArgs(%v) unexpected error: %v", tt.args, err)
+			}
+			if local != tt.wantLocal || tag != tt.wantTag || remote != tt.wantRemote {
+				t.Errorf("splitPushArgs(%v) = (%q, %q, %q), want (%q, %q, %q)",
+					tt.args, local, tag, remote, tt.wantLocal, tt.wantTag, tt.wantRemote)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// commandData is the set of fields available to an -sshcommand template.
+type commandData struct {
+	Hostname     string
+	IP           string
+	Tags         []string
+	OS           string
+	MagicDNSName string
+}
+
+// renderCommand expands commandTemplate as a Go text/template against
+// device, so users can write per-host commands like
+// "sudo systemctl restart {{.Hostname}}-agent". Commands with no
+// template actions round-trip unchanged.
+func renderCommand(commandTemplate *template.Template, device Peer) (string, error) {
+	data := commandData{
+		Hostname:     device.Hostname,
+		Tags:         device.Tags,
+		OS:           device.OS,
+		MagicDNSName: device.MagicDNSName,
+	}
+	if len(device.Addresses) > 0 {
+		data.IP = device.Addresses[0]
+	}
+
+	var buf bytes.Buffer
+	if err := commandTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("rendering -sshcommand for %s: %w", device.Hostname, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"text/template"
+)
+
+func TestRenderCommand(t *testing.T) {
+	device := Peer{
+		Hostname:     "web-1",
+		Addresses:    []string{"100.64.0.1"},
+		Tags:         []string{"tag:web"},
+		OS:           "linux",
+		MagicDNSName: "web-1.tailnet.ts.net.",
+	}
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{name: "no template actions round-trips", tmpl: "echo Hello from $HOST", want: "echo Hello from $HOST"},
+		{name: "hostname", tmpl: "sudo systemctl restart {{.Hostname}}-agent", want: "sudo systemctl restart web-1-agent"},
+		{name: "ip", tmpl: "ping -c1 {{.IP}}", want: "ping -c1 100.64.0.1"},
+		{name: "os and magicdns", tmpl: "{{.OS}} {{.MagicDNSName}}", want: "linux web-1.tailnet.ts.net."},
+		{name: "unknown field errors", tmpl: "{{.Nope}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("sshcommand").Parse(tt.tmpl)
+			if err != nil {
+				t.Fatalf("parsing template %q: %v", tt.tmpl, err)
+			}
+			got, err := renderCommand(tmpl, device)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("renderCommand(%q) = %q, nil; want error", tt.tmpl, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderCommand(%q) unexpected error: %v", tt.tmpl, err)
+			}
+			if got != tt.want {
+				t.Errorf("renderCommand(%q) = %q, want %q", tt.tmpl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderCommandNoAddresses(t *testing.T) {
+	tmpl, err := template.New("sshcommand").Parse("ip={{.IP}}")
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	got, err := renderCommand(tmpl, Peer{Hostname: "no-ip"})
+	if err != nil {
+		t.Fatalf("renderCommand unexpected error: %v", err)
+	}
+	if want := "ip="; got != want {
+		t.Errorf("renderCommand with no addresses = %q, want %q", got, want)
+	}
+}
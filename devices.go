@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+// Peer represents a Tailscale device in the same tailnet as the
+// device from which this command is run.
+type Peer struct {
+	ID           tailcfg.StableNodeID
+	Hostname     string
+	MagicDNSName string
+	Addresses    []string
+	Online       bool
+	Tags         []string
+	OS           string
+	ExitNode     bool
+	LastSeen     time.Time
+	Capabilities []string
+
+	// SSHHostKeys are the peer's SSH host keys as advertised through the
+	// coordination server (authorized_keys format), present only when
+	// the peer runs Tailscale SSH.
+	SSHHostKeys []string
+}
+
+// peerFromStatus converts an ipnstate.PeerStatus, as reported by the
+// local tailscaled, into the Peer shape this tool operates on.
+func peerFromStatus(ps *ipnstate.PeerStatus) Peer {
+	p := Peer{
+		ID:           ps.ID,
+		Hostname:     ps.HostName,
+		MagicDNSName: ps.DNSName,
+		Online:       ps.Online,
+		OS:           ps.OS,
+		ExitNode:     ps.ExitNode,
+		LastSeen:     ps.LastSeen,
+		SSHHostKeys:  ps.SSH_HostKeys,
+	}
+	for _, ip := range ps.TailscaleIPs {
+		p.Addresses = append(p.Addresses, ip.String())
+	}
+	if ps.Tags != nil {
+		for i := 0; i < ps.Tags.Len(); i++ {
+			p.Tags = append(p.Tags, ps.Tags.At(i))
+		}
+	}
+	for _, c := range ps.Capabilities {
+		p.Capabilities = append(p.Capabilities, string(c))
+	}
+	return p
+}
+
+// Check if the device has the specified tag
+func hasTag(device Peer, tag string) bool {
+	for _, t := range device.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// getDevices asks the local tailscaled daemon, via its LocalAPI, for the
+// status of every peer in the tailnet. It deliberately excludes Self,
+// since this tool only ever SSHes to peers.
+//
+// We talk to the LocalAPI rather than shelling out to `tailscale status
+// --json` so that this tool doesn't depend on the tailscale CLI being on
+// PATH, and so it gets a typed, versioned response instead of parsing
+// CLI JSON output. The zero-value tailscale.LocalClient already knows
+// the platform-specific default socket path (e.g. the named pipe on
+// Windows or the GUI socket on macOS), so this works unmodified there.
+func getDevices(ctx context.Context) ([]Peer, error) {
+	var lc tailscale.LocalClient
+	status, err := lc.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting tailscaled status: %w", err)
+	}
+
+	peers := make([]Peer, 0, len(status.Peer))
+	for _, ps := range status.Peer {
+		peers = append(peers, peerFromStatus(ps))
+	}
+
+	return peers, nil
+}
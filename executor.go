@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Executor runs sshCommand as sshUser on device, writing the remote
+// command's stdout and stderr to the given writers as it arrives.
+type Executor interface {
+	Run(ctx context.Context, device Peer, sshUser, sshCommand string, stdout, stderr io.Writer) error
+}
+
+// cliExecutor runs commands by shelling out to the system `ssh` binary.
+// It's the original behavior of this tool, kept as the default so users
+// without a reason to switch see no change.
+type cliExecutor struct {
+	// insecure allows connecting to peers that don't advertise
+	// Tailscale SSH host keys without verifying the host key at all.
+	insecure bool
+}
+
+func (e cliExecutor) Run(ctx context.Context, device Peer, sshUser, sshCommand string, stdout, stderr io.Writer) error {
+	if len(device.Addresses) == 0 {
+		return fmt.Errorf("device %s has no IP addresses", device.Hostname)
+	}
+	ip := device.Addresses[0] // Use the first IP address
+
+	args, cleanup, err := sshHostKeyArgs(device, ip, e.insecure)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	args = append(args, fmt.Sprintf("%s@%s", sshUser, ip), sshCommand)
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
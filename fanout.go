@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sync"
+)
+
+// runConcurrent runs fn once per item, bounded to at most limit
+// goroutines at a time, and streams each call's Result back on the
+// returned channel as it completes. The channel is closed once every
+// item has been processed. It's shared by the exec and push commands so
+// both fan out over their targets the same way.
+func runConcurrent[T any](items []T, limit int, fn func(T) Result) <-chan Result {
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	results := make(chan Result)
+
+	for _, item := range items {
+		wg.Add(1)
+		go func(item T) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results <- fn(item)
+		}(item)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
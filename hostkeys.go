@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// advertisedHostKeys parses the SSH host keys a peer advertised through
+// the coordination server (visible on the peer's Tailscale SSH-enabled
+// Hostinfo) into ssh.PublicKeys we can verify a connection against.
+func advertisedHostKeys(device Peer) ([]ssh.PublicKey, error) {
+	if len(device.SSHHostKeys) == 0 {
+		return nil, nil
+	}
+	keys := make([]ssh.PublicKey, 0, len(device.SSHHostKeys))
+	for _, line := range device.SSHHostKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("parsing advertised host key for %s: %w", device.Hostname, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sshHostKeyArgs returns the `ssh`/`scp` -o options that pin device's
+// advertised Tailscale SSH host keys via a temporary known_hosts file,
+// or that disable verification entirely if device advertises none and
+// insecure is true. It's shared by every command that shells out to an
+// OpenSSH binary, so host-key policy can't drift between them. The
+// returned cleanup must be called once the command has run; it is
+// always non-nil, even on the insecure path.
+func sshHostKeyArgs(device Peer, ip string, insecure bool) (args []string, cleanup func(), err error) {
+	if len(device.SSHHostKeys) > 0 {
+		knownHosts, err := writeTempKnownHosts(ip, device.SSHHostKeys)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pinning advertised host keys for %s: %w", device.Hostname, err)
+		}
+		return []string{"-o", "UserKnownHostsFile=" + knownHosts, "-o", "StrictHostKeyChecking=yes"},
+			func() { os.Remove(knownHosts) }, nil
+	}
+	if insecure {
+		return []string{"-o", "StrictHostKeyChecking=no"}, func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("device %s did not advertise Tailscale SSH host keys; pass -insecure-host-keys to connect without verifying them", device.Hostname)
+}
+
+// writeTempKnownHosts writes a known_hosts file pinning host to exactly
+// the given authorized_keys-format key lines, for use as ssh's
+// UserKnownHostsFile. The caller is responsible for removing the
+// returned path.
+func writeTempKnownHosts(host string, keyLines []string) (path string, err error) {
+	f, err := os.CreateTemp("", "tailscale-multi-ssh-known-hosts-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, line := range keyLines {
+		if _, err := fmt.Fprintf(f, "%s %s\n", host, line); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	return f.Name(), nil
+}
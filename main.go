@@ -1,118 +1,237 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"os/exec"
-	"sync"
-)
+	"os"
+	"regexp"
+	"text/template"
+	"time"
 
-// Peer represents a Tailscale device in the same tailnet as the
-// device from which this command is run.
-type Peer struct {
-	Hostname  string   `json:"Hostname"`
-	Addresses []string `json:"TailscaleIPs"`
-	Online    bool     `json:"Online"`
-	Tags      []string `json:"Tags"`
-}
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
 
-// Response struct
-type Response struct {
-	Peers map[string]Peer `json:"Peer"`
-}
+// errHostsFailed is returned by an Exec function when the run completed
+// without a hard error but at least one host failed, so the process
+// should still exit non-zero.
+var errHostsFailed = errors.New("one or more hosts failed")
+
+// runSSHCommand runs sshCommand as sshUser on device once and returns a
+// Result describing the outcome, along with the raw error (if any) so
+// callers can decide whether it's worth retrying. Result itself never
+// carries an error value, only its string, so it stays plain data for
+// the structured reporters.
+func runSSHCommand(ctx context.Context, exec Executor, device Peer, sshUser, sshCommand string) (Result, error) {
+	res := Result{Hostname: device.Hostname, Tags: device.Tags}
+	if len(device.Addresses) > 0 {
+		res.IP = device.Addresses[0]
+	}
 
-// Parse the tailscale status for peer devices
-func getDevices() ([]Peer, error) {
-	// Users the CLI instead of the API for a few of reasons:
-	// 1. The API doesn't support the "online" field.
-	// 2. We really only want to ssh to Peers and not to Self.
-	// 3. In small tailnets we may not even need to filter by tag.
-	cmd := exec.Command("tailscale", "status", "--json")
-	output, err := cmd.Output()
+	start := time.Now()
+	var stdout, stderr bytes.Buffer
+	err := exec.Run(ctx, device, sshUser, sshCommand, &stdout, &stderr)
+	res.Duration = time.Since(start)
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+	res.ExitCode = exitCodeFromError(err)
 	if err != nil {
-		return nil, err
+		res.Error = err.Error()
 	}
+	return res, err
+}
 
-	// Now, try to unmarshal the output
-	var r Response
-	if err := json.Unmarshal(output, &r); err != nil {
-		return nil, err
-	}
+func main() {
+	os.Exit(runMain(os.Args[1:]))
+}
 
-	// Convert the map of Peers to a slice
-	var peers []Peer
-	for _, peer := range r.Peers {
-		peers = append(peers, peer)
+// runMain builds the command tree and runs it, translating the result
+// into a process exit code.
+func runMain(args []string) int {
+	err := newRootCommand().ParseAndRun(context.Background(), args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errHostsFailed):
+		return 1
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	default:
+		log.Printf("Error: %v\n", err)
+		return 1
 	}
+}
 
-	return peers, nil
+// newRootCommand builds the command tree: running with no subcommand
+// behaves exactly as this tool always has (run -sshcommand on every
+// eligible peer), while "push" copies a file out to peers instead.
+func newRootCommand() *ffcli.Command {
+	fs := flag.NewFlagSet("tailscale-multi-ssh", flag.ExitOnError)
+
+	sshUser := fs.String("sshuser", "root", "SSH user")
+	sshUserByTag := fs.String("sshuser-by-tag", "", "Resolve the SSH user per-peer from its tags, e.g. \"tag:prod=ubuntu,tag:dev=root\" (first match wins; falls back to -sshuser)")
+	sshCommand := fs.String("sshcommand", "echo Hello from $HOST", "SSH command to run, as a Go text/template with .Hostname, .IP, .Tags, .OS, and .MagicDNSName available")
+	deviceTag := fs.String("tag", "", "Filter devices by tag (e.g., tag:example)")
+	sshExecutor := fs.String("ssh-executor", "cli", "SSH executor to use: \"cli\" (shell out to the ssh binary) or \"native\" (use golang.org/x/crypto/ssh)")
+	sshTOFU := fs.Bool("ssh-tofu", false, "With -ssh-executor=native, trust and remember host keys we haven't seen before instead of rejecting them")
+	insecureHostKeys := fs.Bool("insecure-host-keys", false, "Connect to peers that don't advertise Tailscale SSH host keys without verifying the host key at all")
+	output := fs.String("output", "text", "Output format: \"text\", \"table\", \"json\", or \"ndjson\"")
+	failFast := fs.Bool("fail-fast", false, "Cancel outstanding SSH commands as soon as one host fails")
+	maxParallel := fs.Int("max-parallel", 0, "Maximum number of hosts to run against concurrently (0 means min(number of selected hosts, 16))")
+	timeout := fs.Duration("timeout", 0, "Per-host timeout for the SSH command (0 means no timeout)")
+	retries := fs.Int("retries", 0, "Number of times to retry a transient failure (connection refused, DNS/MagicDNS resolution errors, or -retry-exit-codes) with exponential backoff")
+	retryExitCodes := fs.String("retry-exit-codes", "", "Regexp of remote exit codes to treat as transient and retry, e.g. \"^(255)$\"")
+	pick := fs.Bool("pick", false, "Interactively pick which of the eligible hosts to run against")
+
+	return &ffcli.Command{
+		Name:       "tailscale-multi-ssh",
+		ShortUsage: "tailscale-multi-ssh [flags]",
+		ShortHelp:  "Run an SSH command on every eligible peer in the tailnet",
+		FlagSet:    fs,
+		Subcommands: []*ffcli.Command{
+			newPushCommand(),
+		},
+		Exec: func(ctx context.Context, _ []string) error {
+			return runExec(ctx, *sshUser, *sshUserByTag, *sshCommand, *deviceTag, *sshExecutor, *sshTOFU, *insecureHostKeys, *output, *failFast, *maxParallel, *timeout, *retries, *retryExitCodes, *pick)
+		},
+	}
 }
 
-// Check if the device has the specified tag
-func hasTag(device Peer, tag string) bool {
-	for _, t := range device.Tags {
-		if t == tag {
-			return true
+// runExec is the Exec function for the root command: it resolves the
+// eligible peers, runs -sshcommand on each, and reports the results.
+func runExec(ctx context.Context, sshUser, sshUserByTag, sshCommand, deviceTag, sshExecutor string, sshTOFU, insecureHostKeys bool, output string, failFast bool, maxParallel int, timeout time.Duration, retries int, retryExitCodes string, pick bool) error {
+	var retryExitCodesRE *regexp.Regexp
+	if retryExitCodes != "" {
+		var err error
+		retryExitCodesRE, err = regexp.Compile(retryExitCodes)
+		if err != nil {
+			return fmt.Errorf("parsing -retry-exit-codes: %w", err)
 		}
 	}
-	return false
-}
 
-// Run SSH command on a device
-func runSSHCommand(device Peer, sshUser, sshCommand string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	if len(device.Addresses) == 0 {
-		log.Printf("Device %s has no IP addresses.\n", device.Hostname)
-		return
+	userRules, err := parseSSHUserByTag(sshUserByTag)
+	if err != nil {
+		return fmt.Errorf("parsing -sshuser-by-tag: %w", err)
 	}
-	ip := device.Addresses[0] // Use the first IP address
-	log.Printf("Running ssh command on device %s (%s)\n", device.Hostname, ip)
 
-	// Prepare SSH command
-	cmd := exec.Command("ssh", "-o", "StrictHostKeyChecking=no", fmt.Sprintf("%s@%s", sshUser, ip), sshCommand)
+	commandTemplate, err := template.New("sshcommand").Parse(sshCommand)
+	if err != nil {
+		return fmt.Errorf("parsing -sshcommand template: %w", err)
+	}
 
-	// Run the command
-	output, err := cmd.CombinedOutput()
+	reporter, err := newReporter(output, os.Stdout)
 	if err != nil {
-		log.Printf("The ssh command failed on device %s: %v\n", device.Hostname, err)
-		return
+		return fmt.Errorf("configuring -output: %w", err)
 	}
 
-	// Output the result
-	log.Printf("%s ssh command output:\n%s\n", device.Hostname, string(output))
-}
+	devices, err := getDevices(context.Background())
+	if err != nil {
+		return fmt.Errorf("getting devices: %w", err)
+	}
 
-func main() {
-	// Command-line flags
-	sshUser := flag.String("sshuser", "root", "SSH user")
-	sshCommand := flag.String("sshcommand", "echo Hello from $HOST", "SSH command to run")
-	deviceTag := flag.String("tag", "", "Filter devices by tag (e.g., tag:example)")
-	flag.Parse()
-
-	// Get the list of peer devices from Tailscale
-	devices, err := getDevices()
+	executor, err := newExecutor(sshExecutor, sshTOFU, insecureHostKeys)
 	if err != nil {
-		log.Fatalf("Error getting devices: %v\n", err)
+		return fmt.Errorf("configuring SSH executor: %w", err)
+	}
+	if closer, ok := executor.(interface{ Close() error }); ok {
+		defer closer.Close()
 	}
 
-	// WaitGroup to manage goroutines
-	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Iterate over devices and update online ones with the specified tag
+	eligible := eligiblePeers(devices, deviceTag)
+
+	if pick {
+		eligible, err = pickHosts(eligible)
+		if err != nil {
+			return fmt.Errorf("running host picker: %w", err)
+		}
+	}
+
+	// Resolve the per-host user and command up front, so a bad template
+	// or tag rule is reported without spending a slot in the semaphore.
+	type job struct {
+		device  Peer
+		sshUser string
+		command string
+	}
+	var jobs []job
+	for _, device := range eligible {
+		command, err := renderCommand(commandTemplate, device)
+		if err != nil {
+			log.Printf("Skipping device %s: %v\n", device.Hostname, err)
+			continue
+		}
+
+		jobs = append(jobs, job{device, sshUserFor(device, sshUser, userRules), command})
+	}
+
+	limit := boundedParallelism(maxParallel, len(jobs))
+	results := runConcurrent(jobs, limit, func(j job) Result {
+		return runWithRetry(ctx, executor, j.device, j.sshUser, j.command, timeout, retries, retryExitCodesRE)
+	})
+
+	failed := false
+	for res := range results {
+		reporter.Report(res)
+		if res.Failed() {
+			failed = true
+			if failFast {
+				cancel()
+			}
+		}
+	}
+
+	if err := reporter.Finish(); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if failed {
+		return errHostsFailed
+	}
+	return nil
+}
+
+// eligiblePeers filters devices down to those that are online and, if
+// tag is non-empty, carry it.
+func eligiblePeers(devices []Peer, tag string) []Peer {
+	var eligible []Peer
 	for _, device := range devices {
-		if *deviceTag != "" && !hasTag(device, *deviceTag) {
+		if tag != "" && !hasTag(device, tag) {
 			continue
 		}
 		if !device.Online {
 			continue
 		}
-		wg.Add(1)
-		go runSSHCommand(device, *sshUser, *sshCommand, &wg)
+		eligible = append(eligible, device)
+	}
+	return eligible
+}
+
+// boundedParallelism returns maxParallel if positive, else
+// min(njobs, 16).
+func boundedParallelism(maxParallel, njobs int) int {
+	if maxParallel > 0 {
+		return maxParallel
+	}
+	limit := njobs
+	if limit > 16 {
+		limit = 16
 	}
+	return limit
+}
 
-	// Wait for all ssh commands to finish
-	wg.Wait()
-	log.Println("All ssh commands completed.")
+// newExecutor constructs the Executor named by kind.
+func newExecutor(kind string, tofu, insecure bool) (Executor, error) {
+	switch kind {
+	case "cli":
+		return cliExecutor{insecure: insecure}, nil
+	case "native":
+		return newNativeExecutor(tofu, insecure), nil
+	default:
+		return nil, fmt.Errorf("unknown -ssh-executor %q (want \"cli\" or \"native\")", kind)
+	}
 }
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// nativeExecutor runs SSH commands with golang.org/x/crypto/ssh instead of
+// shelling out to the ssh binary. It keeps one *ssh.Client per host alive
+// for the lifetime of a run, so a sequence of commands against the same
+// peer reuses the existing connection rather than renegotiating it.
+type nativeExecutor struct {
+	tofu     bool // accept and remember host keys we haven't seen before
+	insecure bool // skip verification entirely for peers with no advertised host keys
+
+	mu      sync.Mutex
+	clients map[string]*ssh.Client
+}
+
+// newNativeExecutor returns a nativeExecutor. When tofu is true, host
+// keys that aren't already in ~/.ssh/known_hosts are trusted on first
+// use and appended to it; otherwise unknown host keys are rejected.
+// insecure additionally allows skipping verification altogether for
+// peers that don't advertise Tailscale SSH host keys.
+func newNativeExecutor(tofu, insecure bool) *nativeExecutor {
+	return &nativeExecutor{
+		tofu:     tofu,
+		insecure: insecure,
+		clients:  make(map[string]*ssh.Client),
+	}
+}
+
+func (e *nativeExecutor) Run(ctx context.Context, device Peer, sshUser, sshCommand string, stdout, stderr io.Writer) error {
+	if len(device.Addresses) == 0 {
+		return fmt.Errorf("device %s has no IP addresses", device.Hostname)
+	}
+	ip := device.Addresses[0] // Use the first IP address
+	addr := net.JoinHostPort(ip, "22")
+
+	client, err := e.dial(ctx, device, sshUser, addr)
+	if err != nil {
+		return fmt.Errorf("dialing %s@%s: %w", sshUser, addr, err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("opening session to %s@%s: %w", sshUser, addr, err)
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(sshCommand) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		session.Close()
+		return ctx.Err()
+	}
+}
+
+// dial returns a pooled *ssh.Client for user@addr, dialing a new one if
+// this is the first command we've run against that host. The dial and
+// handshake happen outside e.mu so that jobs against different hosts can
+// connect concurrently; only the map check/insert is locked, with a
+// second check after connecting in case two jobs raced to dial the same
+// host.
+func (e *nativeExecutor) dial(ctx context.Context, device Peer, user, addr string) (*ssh.Client, error) {
+	key := user + "@" + addr
+
+	if client, ok := e.pooledClient(key); ok {
+		return client, nil
+	}
+
+	hostKeyCallback, err := e.hostKeyCallbackFor(device)
+	if err != nil {
+		return nil, fmt.Errorf("resolving host key verification: %w", err)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods(),
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	if existing, ok := e.storeClient(key, client); ok {
+		client.Close()
+		return existing, nil
+	}
+	return client, nil
+}
+
+// pooledClient returns the already-pooled client for key, if any.
+func (e *nativeExecutor) pooledClient(key string) (*ssh.Client, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	client, ok := e.clients[key]
+	return client, ok
+}
+
+// storeClient pools client under key, unless another goroutine already
+// dialed and pooled one for the same key first, in which case the
+// existing client is returned so the caller can discard its own.
+func (e *nativeExecutor) storeClient(key string, client *ssh.Client) (existing *ssh.Client, raced bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if existing, ok := e.clients[key]; ok {
+		return existing, true
+	}
+	e.clients[key] = client
+	return nil, false
+}
+
+// Close closes every pooled connection. Callers should invoke it once
+// all commands for a run have completed.
+func (e *nativeExecutor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var firstErr error
+	for key, client := range e.clients {
+		if err := client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(e.clients, key)
+	}
+	return firstErr
+}
+
+// authMethods assembles the SSH auth methods this tool supports: an
+// ssh-agent, if SSH_AUTH_SOCK is set, followed by any unencrypted
+// private keys found under ~/.ssh/id_*.
+func authMethods() []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	if signers := defaultKeySigners(); len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	return methods
+}
+
+// defaultKeySigners loads whichever of the well-known ~/.ssh/id_* private
+// keys are present and unencrypted. Keys that don't parse (e.g. because
+// they're passphrase-protected) are skipped rather than failing the run;
+// the ssh-agent is the expected path for those.
+func defaultKeySigners() []ssh.Signer {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa", "id_dsa"} {
+		data, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+// hostKeyCallbackFor picks the right verification strategy for device.
+// Peers that advertise SSH host keys through the coordination server
+// (Tailscale SSH) are verified against exactly those keys. Otherwise we
+// fall back to ~/.ssh/known_hosts, or to skipping verification entirely
+// if e.insecure is set.
+func (e *nativeExecutor) hostKeyCallbackFor(device Peer) (ssh.HostKeyCallback, error) {
+	keys, err := advertisedHostKeys(device)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return verifyAgainstAdvertisedKeys(device.Hostname, keys), nil
+	}
+	if e.insecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return e.knownHostsCallback()
+}
+
+// verifyAgainstAdvertisedKeys returns a HostKeyCallback that accepts the
+// server's presented key only if it matches one of the keys the peer
+// advertised through the coordination server.
+func verifyAgainstAdvertisedKeys(hostname string, keys []ssh.PublicKey) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, presented ssh.PublicKey) error {
+		marshaled := presented.Marshal()
+		for _, k := range keys {
+			if bytes.Equal(k.Marshal(), marshaled) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key for %s does not match any key advertised via Tailscale SSH", hostname)
+	}
+}
+
+// knownHostsCallback builds a callback that verifies presented host keys
+// against ~/.ssh/known_hosts. With TOFU enabled, a host we've never seen
+// before is trusted and appended to known_hosts; a host whose key has
+// changed is still rejected either way.
+func (e *nativeExecutor) knownHostsCallback() (ssh.HostKeyCallback, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(home, ".ssh", "known_hosts")
+
+	// knownhosts.New requires the file to exist.
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			f.Close()
+		}
+	}
+
+	verify, err := knownhosts.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.tofu {
+		return verify, nil
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := verify(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return appendKnownHost(path, hostname, remote, key)
+		}
+		return err
+	}, nil
+}
+
+// appendKnownHost records a host key we've trusted on first use so that
+// future runs verify against it instead of prompting again.
+func appendKnownHost(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
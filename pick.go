@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// pickHosts runs an interactive fuzzy-filter picker over peers and
+// returns the subset the user selected with space/enter. Cancelling
+// (q/ctrl+c) or confirming with nothing selected both return an empty,
+// nil-error result, so callers can tell "nothing to do" from "picker
+// failed to run" (e.g. no TTY attached).
+func pickHosts(peers []Peer) ([]Peer, error) {
+	items := make([]list.Item, len(peers))
+	for i, p := range peers {
+		items[i] = pickItem{peer: p}
+	}
+
+	l := list.New(items, pickDelegate{}, 80, 20)
+	l.Title = "Select hosts (space: toggle, enter: confirm, q: cancel)"
+	l.SetShowStatusBar(false)
+	l.SetShowHelp(true)
+
+	p := tea.NewProgram(pickModel{list: l})
+	final, err := p.Run()
+	if err != nil {
+		return nil, fmt.Errorf("running host picker: %w", err)
+	}
+
+	return final.(pickModel).selected(), nil
+}
+
+type pickModel struct {
+	list list.Model
+}
+
+func (m pickModel) Init() tea.Cmd { return nil }
+
+func (m pickModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width, msg.Height)
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q":
+			if !m.list.SettingFilter() {
+				return m, tea.Quit
+			}
+		case "enter":
+			if !m.list.SettingFilter() {
+				return m, tea.Quit
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m pickModel) View() string {
+	return m.list.View()
+}
+
+// selected returns the peers the user toggled on, in list order.
+func (m pickModel) selected() []Peer {
+	var out []Peer
+	for _, it := range m.list.Items() {
+		if item, ok := it.(pickItem); ok && item.selected {
+			out = append(out, item.peer)
+		}
+	}
+	return out
+}
+
+// pickItem is a single row in the picker: a peer plus whether the user
+// has toggled it on.
+type pickItem struct {
+	peer     Peer
+	selected bool
+}
+
+func (i pickItem) FilterValue() string { return i.peer.Hostname }
+
+func (i pickItem) ip() string {
+	if len(i.peer.Addresses) > 0 {
+		return i.peer.Addresses[0]
+	}
+	return ""
+}
+
+var (
+	pickCursorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("212"))
+	pickSelectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+)
+
+// pickDelegate renders each row as a checkbox followed by columns for
+// hostname, IP, tags, and OS, and handles the space key to toggle
+// selection.
+type pickDelegate struct{}
+
+func (pickDelegate) Height() int  { return 1 }
+func (pickDelegate) Spacing() int { return 0 }
+func (pickDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok || keyMsg.String() != " " {
+		return nil
+	}
+	item, ok := m.SelectedItem().(pickItem)
+	if !ok {
+		return nil
+	}
+	item.selected = !item.selected
+	return m.SetItem(m.Index(), item)
+}
+
+func (pickDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	item, ok := listItem.(pickItem)
+	if !ok {
+		return
+	}
+
+	checkbox := "[ ]"
+	if item.selected {
+		checkbox = "[x]"
+	}
+	row := fmt.Sprintf("%s %-20s %-15s %-20s %s", checkbox, item.peer.Hostname, item.ip(), strings.Join(item.peer.Tags, ","), item.peer.OS)
+
+	cursor := "  "
+	if index == m.Index() {
+		cursor = "> "
+	}
+	line := cursor + row
+
+	switch {
+	case index == m.Index():
+		line = pickCursorStyle.Render(line)
+	case item.selected:
+		line = pickSelectedStyle.Render(line)
+	}
+	fmt.Fprint(w, line)
+}
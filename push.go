@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"tailscale.com/client/tailscale"
+)
+
+// Pusher copies localPath to remotePath on device, as sshUser. remotePath
+// is advisory: the peerapi backend ignores it, since Taildrop files
+// always land in the receiver's configured Taildrop directory.
+type Pusher interface {
+	Push(ctx context.Context, device Peer, sshUser, localPath, remotePath string) error
+}
+
+// newPusher constructs the Pusher named by kind.
+func newPusher(kind string, insecure bool) (Pusher, error) {
+	switch kind {
+	case "scp":
+		return scpPusher{insecure: insecure}, nil
+	case "peerapi":
+		return peerAPIPusher{}, nil
+	default:
+		return nil, fmt.Errorf("unknown -push-backend %q (want \"scp\" or \"peerapi\")", kind)
+	}
+}
+
+// scpPusher copies files over the existing SSH path by shelling out to
+// scp, pinning host keys the same way cliExecutor does.
+type scpPusher struct {
+	// insecure allows connecting to peers that don't advertise
+	// Tailscale SSH host keys without verifying the host key at all.
+	insecure bool
+}
+
+func (p scpPusher) Push(ctx context.Context, device Peer, sshUser, localPath, remotePath string) error {
+	if len(device.Addresses) == 0 {
+		return fmt.Errorf("device %s has no IP addresses", device.Hostname)
+	}
+	ip := device.Addresses[0]
+
+	args, cleanup, err := sshHostKeyArgs(device, ip, p.insecure)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		args = append(args, "-r")
+	}
+
+	args = append(args, localPath, fmt.Sprintf("%s@%s:%s", sshUser, ip, remotePath))
+
+	cmd := exec.CommandContext(ctx, "scp", args...)
+	return cmd.Run()
+}
+
+// peerAPIPusher delivers files via Taildrop: an HTTP PUT to the peer's
+// PeerAPI file-put endpoint, proxied through the local tailscaled's
+// LocalAPI so no direct connection to the peer's PeerAPI is needed. The
+// destination directory isn't configurable over this path; files land
+// wherever the receiving node has Taildrop configured to put them.
+type peerAPIPusher struct{}
+
+func (peerAPIPusher) Push(ctx context.Context, device Peer, sshUser, localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory; the peerapi push backend only supports single files", localPath)
+	}
+
+	var lc tailscale.LocalClient
+	return lc.PushFile(ctx, device.ID, info.Size(), filepath.Base(localPath), f)
+}
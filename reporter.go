@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Reporter receives one Result per device as it completes and turns
+// them into output for the user. Report may be called concurrently from
+// multiple goroutines. Finish is called once, after every device has
+// reported in, for reporters that need to emit an aggregate view.
+type Reporter interface {
+	Report(Result)
+	Finish() error
+}
+
+// newReporter constructs the Reporter named by kind, writing to w.
+func newReporter(kind string, w io.Writer) (Reporter, error) {
+	switch kind {
+	case "text":
+		return &textReporter{w: w}, nil
+	case "table":
+		return &tableReporter{w: w}, nil
+	case "json":
+		return &jsonReporter{w: w}, nil
+	case "ndjson":
+		return &ndjsonReporter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown -output %q (want \"text\", \"table\", \"json\", or \"ndjson\")", kind)
+	}
+}
+
+// textReporter prints each host's output under its own header as soon
+// as it arrives, grouped the way ansible's default output is.
+type textReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *textReporter) Report(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(r.w, "=== %s (%s) : exit %d in %s ===\n", res.Hostname, res.IP, res.ExitCode, res.Duration)
+	if res.Error != "" {
+		fmt.Fprintf(r.w, "error: %s\n", res.Error)
+	}
+	if res.Stdout != "" {
+		fmt.Fprint(r.w, res.Stdout)
+		if res.Stdout[len(res.Stdout)-1] != '\n' {
+			fmt.Fprintln(r.w)
+		}
+	}
+	if res.Stderr != "" {
+		fmt.Fprintln(r.w, "--- stderr ---")
+		fmt.Fprint(r.w, res.Stderr)
+		if res.Stderr[len(res.Stderr)-1] != '\n' {
+			fmt.Fprintln(r.w)
+		}
+	}
+}
+
+func (r *textReporter) Finish() error { return nil }
+
+// ndjsonReporter streams one JSON object per Result as it arrives, so
+// callers can pipe output into jq without waiting for the whole run.
+type ndjsonReporter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (r *ndjsonReporter) Report(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enc == nil {
+		r.enc = json.NewEncoder(r.w)
+	}
+	r.enc.Encode(res)
+}
+
+func (r *ndjsonReporter) Finish() error { return nil }
+
+// jsonReporter collects every Result and emits them as a single JSON
+// array once the run completes.
+type jsonReporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	results []Result
+}
+
+func (r *jsonReporter) Report(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+func (r *jsonReporter) Finish() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enc := json.NewEncoder(r.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.results)
+}
+
+// tableReporter collects every Result and prints an aligned summary
+// table once the run completes.
+type tableReporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	results []Result
+}
+
+func (r *tableReporter) Report(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+func (r *tableReporter) Finish() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Slice(r.results, func(i, j int) bool { return r.results[i].Hostname < r.results[j].Hostname })
+
+	hostWidth := len("HOSTNAME")
+	ipWidth := len("IP")
+	for _, res := range r.results {
+		hostWidth = max(hostWidth, len(res.Hostname))
+		ipWidth = max(ipWidth, len(res.IP))
+	}
+
+	fmt.Fprintf(r.w, "%-*s  %-*s  %-4s  %s\n", hostWidth, "HOSTNAME", ipWidth, "IP", "EXIT", "DURATION")
+	for _, res := range r.results {
+		fmt.Fprintf(r.w, "%-*s  %-*s  %-4d  %s\n", hostWidth, res.Hostname, ipWidth, res.IP, res.ExitCode, res.Duration)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Result is the outcome of running sshCommand on a single device.
+type Result struct {
+	Hostname string        `json:"hostname"`
+	IP       string        `json:"ip"`
+	Tags     []string      `json:"tags,omitempty"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Failed reports whether the command didn't complete successfully.
+func (r Result) Failed() bool {
+	return r.ExitCode != 0
+}
+
+// exitCodeFromError extracts a process-style exit code from the error
+// returned by an Executor. cliExecutor surfaces *exec.ExitError; the
+// native executor surfaces *ssh.ExitError. Any other non-nil error (a
+// dial failure, a cancelled context, ...) is reported as exit code -1,
+// since the remote command never got a chance to run.
+func exitCodeFromError(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var execErr *exec.ExitError
+	if errors.As(err, &execErr) {
+		return execErr.ExitCode()
+	}
+
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		return sshErr.ExitStatus()
+	}
+
+	return -1
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestExitCodeFromError(t *testing.T) {
+	execErr := exitErrorFromCommand(t, 7)
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil error", err: nil, want: 0},
+		{name: "exec.ExitError", err: execErr, want: 7},
+		{name: "ssh.ExitError", err: &ssh.ExitError{Waitmsg: ssh.Waitmsg{}}, want: 0},
+		{name: "other error", err: errors.New("boom"), want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFromError(tt.err); got != tt.want {
+				t.Errorf("exitCodeFromError(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// exitErrorFromCommand runs a subprocess that exits with code so the
+// test can exercise the real *exec.ExitError type rather than a fake.
+func exitErrorFromCommand(t *testing.T, code int) *exec.ExitError {
+	t.Helper()
+	cmd := exec.CommandContext(context.Background(), "sh", "-c", fmt.Sprintf("exit %d", code))
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected *exec.ExitError from subprocess, got %v", err)
+	}
+	return exitErr
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"tailscale.com/logtail/backoff"
+	"tailscale.com/types/logger"
+)
+
+// runWithRetry runs sshCommand on device, retrying transient failures up
+// to retries additional times with exponential backoff. A failure is
+// transient if it looks like connection refused, a DNS/MagicDNS
+// resolution error, or an exit code matched by retryExitCodes (which may
+// be nil to only retry connection-level failures). timeout, if nonzero,
+// bounds each individual attempt.
+func runWithRetry(ctx context.Context, exec Executor, device Peer, sshUser, sshCommand string, timeout time.Duration, retries int, retryExitCodes *regexp.Regexp) Result {
+	bo := backoff.NewBackoff(device.Hostname, logger.Discard, 5*time.Second)
+
+	for attempt := 0; ; attempt++ {
+		res, err := runAttempt(ctx, exec, device, sshUser, sshCommand, timeout)
+		if err == nil || attempt >= retries || !isTransient(err, res.ExitCode, retryExitCodes) {
+			return res
+		}
+
+		bo.BackOff(ctx, err)
+		if ctx.Err() != nil {
+			return res
+		}
+	}
+}
+
+// runAttempt runs a single attempt of sshCommand, bounding it by timeout
+// if nonzero.
+func runAttempt(ctx context.Context, exec Executor, device Peer, sshUser, sshCommand string, timeout time.Duration) (Result, error) {
+	if timeout <= 0 {
+		return runSSHCommand(ctx, exec, device, sshUser, sshCommand)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return runSSHCommand(attemptCtx, exec, device, sshUser, sshCommand)
+}
+
+// isTransient reports whether err looks like a failure worth retrying:
+// connection refused, a DNS/MagicDNS resolution failure, or an exit code
+// matched by retryExitCodes.
+func isTransient(err error, exitCode int, retryExitCodes *regexp.Regexp) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	if exitCode > 0 && retryExitCodes != nil {
+		return retryExitCodes.MatchString(strconv.Itoa(exitCode))
+	}
+	return false
+}
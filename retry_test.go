@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"syscall"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	retryable := regexp.MustCompile(`^(255)$`)
+
+	tests := []struct {
+		name           string
+		err            error
+		exitCode       int
+		retryExitCodes *regexp.Regexp
+		want           bool
+	}{
+		{name: "nil error", err: nil, want: false},
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "dns error", err: &net.DNSError{Err: "no such host", Name: "bogus.ts.net"}, want: true},
+		{name: "matching exit code", err: errors.New("exit status 255"), exitCode: 255, retryExitCodes: retryable, want: true},
+		{name: "non-matching exit code", err: errors.New("exit status 1"), exitCode: 1, retryExitCodes: retryable, want: false},
+		{name: "exit code with nil regexp", err: errors.New("exit status 255"), exitCode: 255, retryExitCodes: nil, want: false},
+		{name: "unrelated error", err: errors.New("boom"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err, tt.exitCode, tt.retryExitCodes); got != tt.want {
+				t.Errorf("isTransient(%v, %d, %v) = %v, want %v", tt.err, tt.exitCode, tt.retryExitCodes, got, tt.want)
+			}
+		})
+	}
+}
+
+// scriptedExecutor returns one error per call from errs, in order,
+// repeating the last entry if called more times than len(errs).
+type scriptedExecutor struct {
+	errs  []error
+	calls int
+}
+
+func (e *scriptedExecutor) Run(ctx context.Context, device Peer, sshUser, sshCommand string, stdout, stderr io.Writer) error {
+	i := e.calls
+	if i >= len(e.errs) {
+		i = len(e.errs) - 1
+	}
+	e.calls++
+	return e.errs[i]
+}
+
+func TestRunWithRetryRecoversFromTransientFailure(t *testing.T) {
+	exec := &scriptedExecutor{errs: []error{
+		fmt.Errorf("dial: %w", syscall.ECONNREFUSED),
+		fmt.Errorf("dial: %w", syscall.ECONNREFUSED),
+		nil,
+	}}
+
+	res := runWithRetry(context.Background(), exec, Peer{Hostname: "web-1"}, "root", "true", 0, 2, nil)
+
+	if exec.calls != 3 {
+		t.Errorf("calls = %d, want 3", exec.calls)
+	}
+	if res.Error != "" {
+		t.Errorf("Result.Error = %q, want empty after eventual success", res.Error)
+	}
+}
+
+func TestRunWithRetryStopsAfterRetriesExhausted(t *testing.T) {
+	refused := fmt.Errorf("dial: %w", syscall.ECONNREFUSED)
+	exec := &scriptedExecutor{errs: []error{refused, refused, refused, refused}}
+
+	res := runWithRetry(context.Background(), exec, Peer{Hostname: "web-1"}, "root", "true", 0, 2, nil)
+
+	if exec.calls != 3 {
+		t.Errorf("calls = %d, want 3 (1 initial + 2 retries)", exec.calls)
+	}
+	if res.Error == "" {
+		t.Errorf("Result.Error = %q, want the final failure", res.Error)
+	}
+}
+
+func TestRunWithRetryDoesNotRetryNonTransientFailure(t *testing.T) {
+	exec := &scriptedExecutor{errs: []error{errors.New("permission denied"), nil, nil}}
+
+	res := runWithRetry(context.Background(), exec, Peer{Hostname: "web-1"}, "root", "true", 0, 2, nil)
+
+	if exec.calls != 1 {
+		t.Errorf("calls = %d, want 1 (non-transient failures aren't retried)", exec.calls)
+	}
+	if res.Error == "" {
+		t.Errorf("Result.Error = %q, want the failure to be reported", res.Error)
+	}
+}
+
+func TestBoundedParallelism(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxParallel int
+		njobs       int
+		want        int
+	}{
+		{name: "explicit limit wins", maxParallel: 4, njobs: 100, want: 4},
+		{name: "defaults to job count under 16", maxParallel: 0, njobs: 5, want: 5},
+		{name: "defaults cap at 16", maxParallel: 0, njobs: 100, want: 16},
+		{name: "no jobs", maxParallel: 0, njobs: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := boundedParallelism(tt.maxParallel, tt.njobs); got != tt.want {
+				t.Errorf("boundedParallelism(%d, %d) = %d, want %d", tt.maxParallel, tt.njobs, got, tt.want)
+			}
+		})
+	}
+}
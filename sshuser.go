@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tagUser maps an ACL tag to the SSH user that should be used to log
+// into peers carrying it.
+type tagUser struct {
+	tag  string
+	user string
+}
+
+// parseSSHUserByTag parses the -sshuser-by-tag flag value, a
+// comma-separated list of tag=user pairs such as
+// "tag:prod=ubuntu,tag:dev=root". Order is preserved, since peers are
+// resolved against the rules in order of first match.
+func parseSSHUserByTag(s string) ([]tagUser, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var rules []tagUser
+	for _, entry := range strings.Split(s, ",") {
+		tag, user, ok := strings.Cut(entry, "=")
+		if !ok || tag == "" || user == "" {
+			return nil, fmt.Errorf("invalid -sshuser-by-tag entry %q (want tag:name=user)", entry)
+		}
+		rules = append(rules, tagUser{tag: tag, user: user})
+	}
+	return rules, nil
+}
+
+// sshUserFor resolves the SSH user for device: the user from the first
+// matching rule in order, or defaultUser if none of device's tags match.
+func sshUserFor(device Peer, defaultUser string, rules []tagUser) string {
+	for _, rule := range rules {
+		if hasTag(device, rule.tag) {
+			return rule.user
+		}
+	}
+	return defaultUser
+}
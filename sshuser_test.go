@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSSHUserByTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []tagUser
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: nil},
+		{
+			name: "single",
+			in:   "tag:prod=ubuntu",
+			want: []tagUser{{tag: "tag:prod", user: "ubuntu"}},
+		},
+		{
+			name: "multiple preserves order",
+			in:   "tag:prod=ubuntu,tag:dev=root",
+			want: []tagUser{{tag: "tag:prod", user: "ubuntu"}, {tag: "tag:dev", user: "root"}},
+		},
+		{name: "missing equals", in: "tag:prod", wantErr: true},
+		{name: "empty tag", in: "=ubuntu", wantErr: true},
+		{name: "empty user", in: "tag:prod=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSSHUserByTag(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSSHUserByTag(%q) = %v, nil; want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSSHUserByTag(%q) unexpected error: %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSSHUserByTag(%q) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHUserFor(t *testing.T) {
+	rules := []tagUser{
+		{tag: "tag:prod", user: "ubuntu"},
+		{tag: "tag:dev", user: "root"},
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{name: "first rule matches", tags: []string{"tag:prod"}, want: "ubuntu"},
+		{name: "second rule matches", tags: []string{"tag:dev"}, want: "root"},
+		{name: "first match wins when both present", tags: []string{"tag:dev", "tag:prod"}, want: "ubuntu"},
+		{name: "no match falls back to default", tags: []string{"tag:staging"}, want: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := Peer{Tags: tt.tags}
+			if got := sshUserFor(device, "default", rules); got != tt.want {
+				t.Errorf("sshUserFor(%v) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}